@@ -0,0 +1,62 @@
+package httputil
+
+import (
+	"crypto/tls"
+
+	"github.com/iam-kevin/go-errors"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEConfig configures automatic certificates from Let's Encrypt (or any ACME CA) for RunServer.
+//
+// Certificates are obtained on the first TLS handshake for an allowed host, using the
+// TLS-ALPN-01 challenge on the main listener. When HTTPAddr is set, a second listener
+// also answers HTTP-01 challenges and redirects every other request to HTTPS.
+type ACMEConfig struct {
+	// Hosts lists the host names certificates may be requested for
+	Hosts []string
+	// HostPolicy overrides Hosts when more control over allowed host names is needed
+	HostPolicy autocert.HostPolicy
+	// CacheDir is the directory certificates and the account key are stored in.
+	// Without it certificates are requested again on every restart
+	CacheDir string
+	// Email is the contact address registered with the CA
+	Email string
+	// HTTPAddr is the address serving HTTP-01 challenges, usually ":80". Empty disables it
+	HTTPAddr string
+	// DirectoryURL is the ACME directory endpoint. Defaults to Let's Encrypt production
+	DirectoryURL string
+}
+
+// manager builds the autocert.Manager described by the config.
+func (c ACMEConfig) manager() (*autocert.Manager, error) {
+	policy := c.HostPolicy
+	if policy == nil {
+		if len(c.Hosts) == 0 {
+			return nil, errors.New("acme requires Hosts or a HostPolicy")
+		}
+		policy = autocert.HostWhitelist(c.Hosts...)
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: policy,
+		Email:      c.Email,
+	}
+	if c.CacheDir != "" {
+		m.Cache = autocert.DirCache(c.CacheDir)
+	}
+	if c.DirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: c.DirectoryURL}
+	}
+
+	return m, nil
+}
+
+// serverTLSConfig builds the *tls.Config serving certificates from the given manager.
+func (c ACMEConfig) serverTLSConfig(m *autocert.Manager) *tls.Config {
+	cfg := m.TLSConfig()
+	cfg.MinVersion = tls.VersionTLS12
+	return cfg
+}
@@ -0,0 +1,119 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestACMEConfigManager(t *testing.T) {
+	allowAll := func(context.Context, string) error { return nil }
+
+	tests := []struct {
+		name       string
+		cfg        ACMEConfig
+		wantErr    bool
+		allowed    []string
+		denied     []string
+		wantCache  autocert.Cache
+		wantClient string
+	}{
+		{
+			name:    "no hosts",
+			cfg:     ACMEConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "hosts",
+			cfg:     ACMEConfig{Hosts: []string{"api.example.com"}},
+			allowed: []string{"api.example.com"},
+			denied:  []string{"other.example.com"},
+		},
+		{
+			name:    "host policy overrides hosts",
+			cfg:     ACMEConfig{Hosts: []string{"api.example.com"}, HostPolicy: allowAll},
+			allowed: []string{"api.example.com", "other.example.com"},
+		},
+		{
+			name:      "cache dir",
+			cfg:       ACMEConfig{Hosts: []string{"api.example.com"}, CacheDir: "/var/cache/acme"},
+			wantCache: autocert.DirCache("/var/cache/acme"),
+		},
+		{
+			name:       "directory URL",
+			cfg:        ACMEConfig{Hosts: []string{"api.example.com"}, DirectoryURL: "https://acme-staging-v02.api.letsencrypt.org/directory"},
+			wantClient: "https://acme-staging-v02.api.letsencrypt.org/directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.cfg.manager()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("manager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			for _, host := range tt.allowed {
+				if err := m.HostPolicy(context.Background(), host); err != nil {
+					t.Errorf("HostPolicy(%q) = %v, want nil", host, err)
+				}
+			}
+			for _, host := range tt.denied {
+				if err := m.HostPolicy(context.Background(), host); err == nil {
+					t.Errorf("HostPolicy(%q) = nil, want an error", host)
+				}
+			}
+
+			if m.Cache != tt.wantCache {
+				t.Errorf("Cache = %#v, want %#v", m.Cache, tt.wantCache)
+			}
+
+			if tt.wantClient == "" {
+				if m.Client != nil {
+					t.Errorf("Client = %+v, want nil", m.Client)
+				}
+			} else if m.Client == nil || m.Client.DirectoryURL != tt.wantClient {
+				t.Errorf("Client = %+v, want DirectoryURL %q", m.Client, tt.wantClient)
+			}
+		})
+	}
+}
+
+func TestACMEConfigServerTLSConfig(t *testing.T) {
+	cfg := ACMEConfig{Hosts: []string{"api.example.com"}}
+	m, err := cfg.manager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig := cfg.serverTLSConfig(m)
+
+	if tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want %x", tlsConfig.MinVersion, tls.VersionTLS12)
+	}
+	if !slices.Contains(tlsConfig.NextProtos, acme.ALPNProto) {
+		t.Errorf("NextProtos = %q, want it to contain %q", tlsConfig.NextProtos, acme.ALPNProto)
+	}
+	if tlsConfig.GetCertificate == nil {
+		t.Error("GetCertificate is not set")
+	}
+}
+
+func TestRunServerRejectsTLSAndACME(t *testing.T) {
+	err := RunServer(context.Background(), ServerConfig{
+		Addr: "127.0.0.1:0",
+		TLS:  &TLSConfig{CertFile: "tls.crt", KeyFile: "tls.key"},
+		ACME: &ACMEConfig{Hosts: []string{"api.example.com"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "TLS and ACME") {
+		t.Fatalf("RunServer() error = %v, want an error for TLS and ACME together", err)
+	}
+}
@@ -0,0 +1,92 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/iam-kevin/go-errors"
+)
+
+// DefaultAdminOnlyPrefixes are the path prefixes that are never served on the public
+// listener when an admin listener is configured.
+var DefaultAdminOnlyPrefixes = []string{"/debug", "/metrics"}
+
+// AdminConfig configures a separate admin listener for RunServer, serving health,
+// metrics, pprof and other operational endpoints away from the public API.
+type AdminConfig struct {
+	// Addr is the TCP address of the admin listener, e.g. "127.0.0.1:9090"
+	Addr string
+	// Handler serves the admin endpoints. Defaults to NewAdminMux()
+	Handler http.Handler
+	// AdminOnlyPrefixes are paths answered with 404 on the public listener, along with
+	// everything below them ("/metrics" matches "/metrics/x" but not "/metricsboard").
+	// They are added to DefaultAdminOnlyPrefixes, which are always denied
+	AdminOnlyPrefixes []string
+}
+
+// adminOnlyPrefixes returns DefaultAdminOnlyPrefixes followed by the configured prefixes.
+func (c AdminConfig) adminOnlyPrefixes() []string {
+	return append(slices.Clone(DefaultAdminOnlyPrefixes), c.AdminOnlyPrefixes...)
+}
+
+// validate checks the admin config against the public server config.
+func (c AdminConfig) validate(public ServerConfig) error {
+	if c.Addr == "" {
+		return errors.New("admin listener requires an Addr")
+	}
+	if c.Addr == public.Addr {
+		return errors.New("admin listener must not share the public listener address")
+	}
+	// net/http/pprof registers itself on http.DefaultServeMux when imported, so serving it
+	// publicly would expose the debug endpoints.
+	if public.Handler == nil || public.Handler == http.DefaultServeMux {
+		return errors.New("public handler must not be http.DefaultServeMux when an admin listener is configured")
+	}
+
+	return nil
+}
+
+// NewAdminMux returns a mux with the standard admin endpoints:
+//
+//   - GET /healthz answers {"ok": true}
+//   - /debug/pprof/ serves the runtime profiles from net/http/pprof
+//
+// More endpoints (metrics, introspection, ...) can be registered on the returned mux.
+//
+// Example:
+//
+//	admin := httputil.NewAdminMux()
+//	admin.Handle("GET /metrics", metricsHandler)
+func NewAdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
+
+// denyPathPrefixes answers requests for any of the prefixes, or a path below one of
+// them, with 404 Not Found, keeping admin-only endpoints off the public listener.
+func denyPathPrefixes(next http.Handler, prefixes []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := path.Clean("/" + r.URL.Path)
+		for _, prefix := range prefixes {
+			prefix = strings.TrimSuffix(prefix, "/")
+			if p == prefix || strings.HasPrefix(p, prefix+"/") {
+				ErrorWithStatus(w, http.StatusNotFound, "not found")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
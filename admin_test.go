@@ -0,0 +1,76 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDenyPathPrefixes(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+
+	tests := []struct {
+		name     string
+		prefixes []string
+		path     string
+		want     int
+	}{
+		{"exact prefix", []string{"/metrics"}, "/metrics", http.StatusNotFound},
+		{"below prefix", []string{"/metrics"}, "/metrics/x", http.StatusNotFound},
+		{"prefix with trailing slash", []string{"/debug/"}, "/debug/pprof/", http.StatusNotFound},
+		{"partial segment", []string{"/metrics"}, "/metricsboard", http.StatusOK},
+		{"unrelated path", []string{"/metrics"}, "/api/users", http.StatusOK},
+		{"dot segments", []string{"/debug"}, "/api/../debug/pprof/", http.StatusNotFound},
+		{"double slashes", []string{"/debug"}, "//debug//pprof/", http.StatusNotFound},
+		{"no prefixes", nil, "/debug/pprof/", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = tt.path
+			rec := httptest.NewRecorder()
+
+			denyPathPrefixes(next, tt.prefixes).ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("GET %s with prefixes %q: status = %d, want %d", tt.path, tt.prefixes, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminConfigAdminOnlyPrefixes(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+
+	tests := []struct {
+		name     string
+		prefixes []string
+		path     string
+		want     int
+	}{
+		{"defaults without custom prefixes", nil, "/debug/pprof/", http.StatusNotFound},
+		{"defaults with empty custom prefixes", []string{}, "/debug/pprof/", http.StatusNotFound},
+		{"defaults with custom prefixes", []string{"/internal"}, "/debug/pprof/", http.StatusNotFound},
+		{"metrics with custom prefixes", []string{"/internal"}, "/metrics", http.StatusNotFound},
+		{"custom prefix", []string{"/internal"}, "/internal/state", http.StatusNotFound},
+		{"public path", []string{"/internal"}, "/api/users", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := AdminConfig{AdminOnlyPrefixes: tt.prefixes}
+			rec := httptest.NewRecorder()
+
+			denyPathPrefixes(next, cfg.adminOnlyPrefixes()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.want {
+				t.Errorf("GET %s with prefixes %q: status = %d, want %d", tt.path, tt.prefixes, rec.Code, tt.want)
+			}
+		})
+	}
+}
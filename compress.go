@@ -0,0 +1,180 @@
+package httputil
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		v, err := strconv.ParseFloat(q, 64)
+		return err == nil && v > 0
+	}
+
+	return false
+}
+
+// gzipMinSize is the body size below which responses are sent uncompressed.
+const gzipMinSize = 1024
+
+// gzipWriter compresses the response body. The status is held back until gzipMinSize
+// bytes are written, or the handler flushes or returns, so that the Content-Type can
+// still be sniffed from the body and small bodies are sent as they are.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	status  int
+	buf     []byte
+	started bool
+}
+
+func (gw *gzipWriter) WriteHeader(status int) {
+	// informational responses are followed by the final one
+	if gw.started || status < http.StatusOK {
+		gw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if gw.status == 0 {
+		gw.status = status
+	}
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if !gw.started {
+		gw.buf = append(gw.buf, b...)
+		if len(gw.buf) < gzipMinSize {
+			return len(b), nil
+		}
+		if err := gw.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if gw.gz == nil {
+		return gw.ResponseWriter.Write(b)
+	}
+
+	return gw.gz.Write(b)
+}
+
+// start writes the headers, compressing the body if compress is set and the response
+// allows it, followed by the buffered body.
+func (gw *gzipWriter) start(compress bool) error {
+	gw.started = true
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+
+	h := gw.Header()
+	if len(gw.buf) > 0 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(gw.buf))
+	}
+	if compress && h.Get("Content-Encoding") == "" && gw.status != http.StatusNoContent && gw.status != http.StatusNotModified {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		gw.gz = gzipWriters.Get().(*gzip.Writer)
+		gw.gz.Reset(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if gw.gz == nil {
+		_, err = gw.ResponseWriter.Write(buf)
+	} else {
+		_, err = gw.gz.Write(buf)
+	}
+	return err
+}
+
+// Flush implements http.Flusher, sending the headers and the compressed data written so far.
+func (gw *gzipWriter) Flush() {
+	if !gw.started {
+		gw.start(true)
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (gw *gzipWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// close sends a response still held back uncompressed, flushes the remaining
+// compressed data and returns the gzip writer to the pool.
+func (gw *gzipWriter) close() {
+	// without a status or body there is nothing to send, e.g. after a hijack
+	if !gw.started && (gw.status != 0 || len(gw.buf) > 0) {
+		if len(gw.buf) > 0 && gw.Header().Get("Content-Length") == "" {
+			gw.Header().Set("Content-Length", strconv.Itoa(len(gw.buf)))
+		}
+		gw.start(false)
+	}
+
+	if gw.gz == nil {
+		return
+	}
+	gw.gz.Close()
+	gzipWriters.Put(gw.gz)
+	gw.gz = nil
+}
+
+// MiddlewareGzip is a middleware compressing responses with gzip for clients that accept it.
+//
+// Responses that already set a Content-Encoding, bodies smaller than 1KB, HEAD
+// requests and connection upgrades (e.g. websockets) are left uncompressed.
+//
+// Panic recovery should be mounted inside MiddlewareGzip: once the compressed body
+// has started, an error response written by an outer recoverer can only be appended
+// to it uncompressed.
+func MiddlewareGzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: w}
+		defer func() {
+			if err := recover(); err != nil {
+				// a response held back is dropped so that a recoverer outside can still
+				// answer with its own status, one already started is completed as a
+				// valid gzip stream
+				if gw.started {
+					gw.close()
+				}
+				panic(err)
+			}
+		}()
+
+		next.ServeHTTP(gw, r)
+		gw.close()
+	})
+}
@@ -0,0 +1,259 @@
+package httputil
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareGzip(t *testing.T) {
+	large := "<!DOCTYPE html><html><body>" + strings.Repeat("hello world ", 200) + "</body></html>"
+	small := "<!DOCTYPE html><html><body>hello</body></html>"
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		wantStatus     int
+		wantEncoding   string
+		wantType       string
+		wantBody       string
+		wantFlushed    bool
+	}{
+		{
+			name:           "large body",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, large)
+			},
+			wantStatus:   http.StatusOK,
+			wantEncoding: "gzip",
+			wantType:     "text/html; charset=utf-8",
+			wantBody:     large,
+		},
+		{
+			name:           "large body in small writes",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < len(large); i += 100 {
+					io.WriteString(w, large[i:min(i+100, len(large))])
+				}
+			},
+			wantStatus:   http.StatusOK,
+			wantEncoding: "gzip",
+			wantType:     "text/html; charset=utf-8",
+			wantBody:     large,
+		},
+		{
+			name:           "explicit status with large body",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, large)
+			},
+			wantStatus:   http.StatusCreated,
+			wantEncoding: "gzip",
+			wantType:     "text/html; charset=utf-8",
+			wantBody:     large,
+		},
+		{
+			name:           "explicit status with small body",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				io.WriteString(w, small)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantType:   "text/html; charset=utf-8",
+			wantBody:   small,
+		},
+		{
+			name:           "small body",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, small)
+			},
+			wantStatus: http.StatusOK,
+			wantType:   "text/html; charset=utf-8",
+			wantBody:   small,
+		},
+		{
+			name:           "explicit content type",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, large)
+			},
+			wantStatus:   http.StatusOK,
+			wantEncoding: "gzip",
+			wantType:     "application/json",
+			wantBody:     large,
+		},
+		{
+			name:           "no content",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:           "already encoded",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, large)
+			},
+			wantStatus:   http.StatusOK,
+			wantEncoding: "br",
+			wantType:     "text/html; charset=utf-8",
+			wantBody:     large,
+		},
+		{
+			name:           "gzip not accepted",
+			acceptEncoding: "gzip;q=0, br",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusOK,
+			wantType:   "text/html; charset=utf-8",
+			wantBody:   large,
+		},
+		{
+			name:           "flushed small body",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, "data: hello\n\n")
+				http.NewResponseController(w).Flush()
+			},
+			wantStatus:   http.StatusOK,
+			wantEncoding: "gzip",
+			wantType:     "text/event-stream",
+			wantBody:     "data: hello\n\n",
+			wantFlushed:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+
+			MiddlewareGzip(tt.handler).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if rec.Flushed != tt.wantFlushed {
+				t.Errorf("flushed = %v, want %v", rec.Flushed, tt.wantFlushed)
+			}
+
+			body := rec.Body.String()
+			if tt.wantEncoding == "gzip" {
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(b)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMiddlewareGzipPanic(t *testing.T) {
+	handler := MiddlewareHTTPAssertionRecoverer(MiddlewareGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "partial")
+		panic("boom")
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if strings.Contains(rec.Body.String(), "partial") {
+		t.Errorf("body = %q, the held back response was sent", rec.Body.String())
+	}
+}
+
+func TestMiddlewareGzipPanicAfterWrite(t *testing.T) {
+	body := strings.Repeat("a", 4096)
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+		panic("boom")
+	})
+
+	// decode checks that the body is a complete gzip stream and returns its content.
+	decode := func(t *testing.T, rec *httptest.ResponseRecorder) string {
+		t.Helper()
+		if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want %q", got, "gzip")
+		}
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("reading the gzip body: %v", err)
+		}
+		return string(b)
+	}
+
+	t.Run("default stack", func(t *testing.T) {
+		stack := BuildStack(DefaultStackConfig())
+		stack.Handle("GET /", panicking)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		stack.Handler().ServeHTTP(rec, req)
+
+		got := decode(t, rec)
+		if !strings.HasPrefix(got, body) || !strings.Contains(got[len(body):], `"ok":false`) {
+			t.Errorf("body = %q, want the written body followed by the JSON error", got)
+		}
+	})
+
+	t.Run("panic is propagated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("the panic was not propagated")
+				}
+			}()
+			MiddlewareGzip(panicking).ServeHTTP(rec, req)
+		}()
+
+		if got := decode(t, rec); got != body {
+			t.Errorf("body = %q, want %q", got, body)
+		}
+	})
+}
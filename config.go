@@ -0,0 +1,327 @@
+package httputil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a string such as "30s" or "1m30s"
+// in JSON, YAML and environment variables.
+type Duration time.Duration
+
+// Duration returns the value as a time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns the duration formatted like time.Duration.String.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Names of the middlewares assembled by BuildStack, in chain order, outermost first.
+// They are the keys of StackConfig.Overrides and of the Stack features.
+const (
+	StackRequestID    = "request_id"
+	StackLogging      = "logging"
+	StackMetrics      = "metrics"
+	StackCORS         = "cors"
+	StackCompression  = "compression"
+	StackRecoverer    = "recoverer"
+	StackMaxBodyBytes = "max_body_bytes"
+	StackTimeout      = "timeout"
+	StackAuth         = "auth"
+)
+
+// StackConfig declares the middleware chain assembled by BuildStack.
+//
+// The plain fields can be loaded with LoadStackConfigFromEnv, LoadStackConfigJSON,
+// or any YAML library through the yaml tags (decode into DefaultStackConfig() to
+// keep the defaults, then call Validate). The function fields can only be set from code.
+type StackConfig struct {
+	// RequestID enables MiddlewareRequestID
+	RequestID bool `json:"request_id" yaml:"request_id"`
+	// Logging enables MiddlewareLogging
+	Logging bool `json:"logging" yaml:"logging"`
+	// Recoverer enables MiddlewareHTTPAssertionRecoverer
+	Recoverer bool `json:"recoverer" yaml:"recoverer"`
+	// CORS enables MiddlewareCORS when set
+	CORS *CORSConfig `json:"cors" yaml:"cors"`
+	// MaxBodyBytes limits request bodies when > 0
+	MaxBodyBytes int64 `json:"max_body_bytes" yaml:"max_body_bytes"`
+	// RequestTimeout bounds the handler duration when > 0, see MiddlewareTimeout.
+	// It applies to every route, so leave it off when serving websockets, server-sent
+	// events or large downloads
+	RequestTimeout Duration `json:"request_timeout" yaml:"request_timeout"`
+	// Compression enables MiddlewareGzip
+	Compression bool `json:"compression" yaml:"compression"`
+	// AuthTokens enables MiddlewareBearerToken with these tokens, unless Auth is set
+	AuthTokens []string `json:"auth_tokens" yaml:"auth_tokens"`
+
+	// Metrics enables MiddlewareMetrics reporting to this recorder
+	Metrics MetricsRecorder `json:"-" yaml:"-"`
+	// Auth is the authentication middleware, taking precedence over AuthTokens
+	Auth Middleware `json:"-" yaml:"-"`
+	// Overrides replaces the middleware with the given name (see the Stack* constants).
+	// A nil middleware removes it from the chain
+	Overrides map[string]Middleware `json:"-" yaml:"-"`
+}
+
+// Validate checks the config for combinations BuildStack refuses, such as CORS
+// credentials for the "*" origin. The Load* functions call it already; configs
+// decoded some other way, e.g. from YAML, should be checked with it before BuildStack.
+func (c StackConfig) Validate() error {
+	if c.CORS != nil {
+		return c.CORS.validate()
+	}
+
+	return nil
+}
+
+// DefaultStackConfig returns the production defaults: request IDs, logging, panic
+// recovery and compression enabled, with 1MB request bodies. There is no request
+// timeout, as MiddlewareTimeout does not support streaming or hijacked connections.
+func DefaultStackConfig() StackConfig {
+	return StackConfig{
+		RequestID:    true,
+		Logging:      true,
+		Recoverer:    true,
+		MaxBodyBytes: 1 << 20,
+		Compression:  true,
+	}
+}
+
+// LoadStackConfigJSON decodes a StackConfig from JSON on top of DefaultStackConfig.
+// Unknown fields and CORS credentials for the "*" origin are rejected.
+//
+// Example:
+//
+//	{
+//		"max_body_bytes": 5242880,
+//		"request_timeout": "10s",
+//		"cors": {"allowed_origins": ["https://app.example.com"]}
+//	}
+func LoadStackConfigJSON(r io.Reader) (StackConfig, error) {
+	cfg := DefaultStackConfig()
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return StackConfig{}, fmt.Errorf("decoding stack config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return StackConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// LoadStackConfigFromEnv reads a StackConfig from environment variables on top of
+// DefaultStackConfig. Every variable name starts with the given prefix:
+//
+//	<prefix>REQUEST_ID              bool
+//	<prefix>LOGGING                 bool
+//	<prefix>RECOVERER               bool
+//	<prefix>MAX_BODY_BYTES          int
+//	<prefix>REQUEST_TIMEOUT         duration, e.g. "30s"
+//	<prefix>COMPRESSION             bool
+//	<prefix>AUTH_TOKENS             comma separated list
+//	<prefix>CORS_ALLOWED_ORIGINS    comma separated list, enables CORS
+//	<prefix>CORS_ALLOWED_METHODS    comma separated list
+//	<prefix>CORS_ALLOWED_HEADERS    comma separated list
+//	<prefix>CORS_EXPOSED_HEADERS    comma separated list
+//	<prefix>CORS_ALLOW_CREDENTIALS  bool
+//	<prefix>CORS_MAX_AGE            duration
+//
+// CORS credentials for the "*" origin are rejected.
+//
+// Example:
+//
+//	cfg, err := httputil.LoadStackConfigFromEnv("HTTP_")
+func LoadStackConfigFromEnv(prefix string) (StackConfig, error) {
+	cfg := DefaultStackConfig()
+	env := envReader{prefix: prefix}
+
+	env.bool("REQUEST_ID", &cfg.RequestID)
+	env.bool("LOGGING", &cfg.Logging)
+	env.bool("RECOVERER", &cfg.Recoverer)
+	env.int64("MAX_BODY_BYTES", &cfg.MaxBodyBytes)
+	env.duration("REQUEST_TIMEOUT", &cfg.RequestTimeout)
+	env.bool("COMPRESSION", &cfg.Compression)
+	env.list("AUTH_TOKENS", &cfg.AuthTokens)
+
+	var cors CORSConfig
+	if env.list("CORS_ALLOWED_ORIGINS", &cors.AllowedOrigins) {
+		env.list("CORS_ALLOWED_METHODS", &cors.AllowedMethods)
+		env.list("CORS_ALLOWED_HEADERS", &cors.AllowedHeaders)
+		env.list("CORS_EXPOSED_HEADERS", &cors.ExposedHeaders)
+		env.bool("CORS_ALLOW_CREDENTIALS", &cors.AllowCredentials)
+		env.duration("CORS_MAX_AGE", &cors.MaxAge)
+		cfg.CORS = &cors
+	}
+
+	if env.err != nil {
+		return StackConfig{}, env.err
+	}
+	if err := cfg.Validate(); err != nil {
+		return StackConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// envReader reads prefixed environment variables, keeping the first parse error.
+type envReader struct {
+	prefix string
+	err    error
+}
+
+// lookup returns the value of the variable, reporting whether it is set and not empty.
+func (e *envReader) lookup(key string) (string, bool) {
+	v, ok := os.LookupEnv(e.prefix + key)
+	return v, ok && v != ""
+}
+
+func (e *envReader) fail(key string, err error) {
+	if e.err == nil {
+		e.err = fmt.Errorf("%s%s: %w", e.prefix, key, err)
+	}
+}
+
+func (e *envReader) bool(key string, dst *bool) {
+	if v, ok := e.lookup(key); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			e.fail(key, err)
+			return
+		}
+		*dst = b
+	}
+}
+
+func (e *envReader) int64(key string, dst *int64) {
+	if v, ok := e.lookup(key); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			e.fail(key, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) duration(key string, dst *Duration) {
+	if v, ok := e.lookup(key); ok {
+		if err := dst.UnmarshalText([]byte(v)); err != nil {
+			e.fail(key, err)
+		}
+	}
+}
+
+func (e *envReader) list(key string, dst *[]string) bool {
+	v, ok := e.lookup(key)
+	if !ok {
+		return false
+	}
+
+	*dst = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*dst = append(*dst, item)
+		}
+	}
+	return true
+}
+
+// BuildStack assembles the standard middleware chain described by the config, in
+// this order, outermost first:
+//
+//	request_id, logging, metrics, cors, compression, recoverer, max_body_bytes, timeout, auth
+//
+// Panics are recovered inside logging and metrics so failed requests are still
+// reported, and inside compression so the error response is part of the compressed
+// body. Compression wraps the timeout so its headers are not replaced by the
+// buffered response, and authentication runs last so rejected requests are still logged,
+// measured and given CORS headers. The returned Stack reports the enabled
+// middlewares, limits and features on its IntrospectionHandler. Limits are only
+// reported for the middlewares mounted from the config, not for overridden ones.
+//
+// Like MiddlewareCORS, BuildStack panics if the CORS config allows credentials for
+// the "*" origin; Validate and the Load* functions return an error for it instead.
+//
+// Example:
+//
+//	cfg, err := httputil.LoadStackConfigFromEnv("HTTP_")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	cfg.Auth = sessionAuth
+//
+//	stack := httputil.BuildStack(cfg)
+//	stack.HandleFunc("GET /users", listUsers)
+//
+//	server := &http.Server{Handler: stack.Handler()}
+func BuildStack(cfg StackConfig) *Stack {
+	s := NewStack()
+	// use mounts the middleware when enabled, or its override when there is one, and
+	// reports whether the configured middleware was mounted, so that only its limits
+	// are recorded
+	use := func(name string, enabled bool, mw func() Middleware) bool {
+		if override, ok := cfg.Overrides[name]; ok {
+			s.SetFeature(name, override != nil)
+			if override != nil {
+				s.Use(name, override)
+			}
+			return false
+		}
+
+		s.SetFeature(name, enabled)
+		if enabled {
+			s.Use(name, mw())
+		}
+		return enabled
+	}
+
+	use(StackRequestID, cfg.RequestID, func() Middleware { return MiddlewareRequestID })
+	use(StackLogging, cfg.Logging, func() Middleware { return MiddlewareLogging })
+	use(StackMetrics, cfg.Metrics != nil, func() Middleware { return MiddlewareMetrics(cfg.Metrics) })
+	if use(StackCORS, cfg.CORS != nil, func() Middleware { return MiddlewareCORS(*cfg.CORS) }) {
+		s.SetLimit("cors_allowed_origins", cfg.CORS.AllowedOrigins)
+	}
+	use(StackCompression, cfg.Compression, func() Middleware { return MiddlewareGzip })
+	use(StackRecoverer, cfg.Recoverer, func() Middleware { return MiddlewareHTTPAssertionRecoverer })
+	if use(StackMaxBodyBytes, cfg.MaxBodyBytes > 0, func() Middleware { return MiddlewareMaxBodyBytes(cfg.MaxBodyBytes) }) {
+		s.SetLimit(StackMaxBodyBytes, cfg.MaxBodyBytes)
+	}
+	if use(StackTimeout, cfg.RequestTimeout > 0, func() Middleware { return MiddlewareTimeout(cfg.RequestTimeout.Duration()) }) {
+		s.SetLimit("request_timeout", cfg.RequestTimeout.String())
+	}
+	use(StackAuth, cfg.Auth != nil || len(cfg.AuthTokens) > 0, func() Middleware {
+		if cfg.Auth != nil {
+			return cfg.Auth
+		}
+		return MiddlewareBearerToken(cfg.AuthTokens...)
+	})
+
+	return s
+}
@@ -0,0 +1,400 @@
+package httputil
+
+import (
+	"encoding"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildStack(t *testing.T) {
+	passthrough := func(next http.Handler) http.Handler { return next }
+
+	tests := []struct {
+		name            string
+		cfg             func() StackConfig
+		wantMiddlewares []string
+		wantLimits      map[string]interface{}
+		wantFeatures    map[string]bool
+	}{
+		{
+			name: "defaults",
+			cfg:  DefaultStackConfig,
+			wantMiddlewares: []string{
+				StackRequestID, StackLogging, StackCompression, StackRecoverer, StackMaxBodyBytes,
+			},
+			wantLimits: map[string]interface{}{
+				StackMaxBodyBytes: int64(1 << 20),
+			},
+			wantFeatures: map[string]bool{StackMaxBodyBytes: true, StackTimeout: false, StackCORS: false},
+		},
+		{
+			name: "everything enabled",
+			cfg: func() StackConfig {
+				cfg := DefaultStackConfig()
+				cfg.RequestTimeout = Duration(10 * time.Second)
+				cfg.CORS = &CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}
+				cfg.AuthTokens = []string{"secret"}
+				return cfg
+			},
+			wantMiddlewares: []string{
+				StackRequestID, StackLogging, StackCORS, StackCompression, StackRecoverer,
+				StackMaxBodyBytes, StackTimeout, StackAuth,
+			},
+			wantLimits: map[string]interface{}{
+				StackMaxBodyBytes:      int64(1 << 20),
+				"request_timeout":      "10s",
+				"cors_allowed_origins": []string{"https://app.example.com"},
+			},
+			wantFeatures: map[string]bool{StackMaxBodyBytes: true, StackTimeout: true, StackCORS: true, StackAuth: true},
+		},
+		{
+			name: "removed by overrides",
+			cfg: func() StackConfig {
+				cfg := DefaultStackConfig()
+				cfg.RequestTimeout = Duration(10 * time.Second)
+				cfg.CORS = &CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}
+				cfg.Overrides = map[string]Middleware{
+					StackMaxBodyBytes: nil,
+					StackTimeout:      nil,
+					StackCORS:         nil,
+				}
+				return cfg
+			},
+			wantMiddlewares: []string{StackRequestID, StackLogging, StackCompression, StackRecoverer},
+			wantLimits:      map[string]interface{}{},
+			wantFeatures:    map[string]bool{StackMaxBodyBytes: false, StackTimeout: false, StackCORS: false},
+		},
+		{
+			name: "replaced by overrides",
+			cfg: func() StackConfig {
+				cfg := DefaultStackConfig()
+				cfg.RequestTimeout = Duration(10 * time.Second)
+				cfg.Overrides = map[string]Middleware{
+					StackMaxBodyBytes: passthrough,
+					StackTimeout:      passthrough,
+				}
+				return cfg
+			},
+			wantMiddlewares: []string{
+				StackRequestID, StackLogging, StackCompression, StackRecoverer, StackMaxBodyBytes, StackTimeout,
+			},
+			wantLimits:   map[string]interface{}{},
+			wantFeatures: map[string]bool{StackMaxBodyBytes: true, StackTimeout: true},
+		},
+		{
+			name: "enabled by overrides",
+			cfg: func() StackConfig {
+				cfg := StackConfig{}
+				cfg.Overrides = map[string]Middleware{StackAuth: passthrough}
+				return cfg
+			},
+			wantMiddlewares: []string{StackAuth},
+			wantLimits:      map[string]interface{}{},
+			wantFeatures:    map[string]bool{StackAuth: true, StackLogging: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc := BuildStack(tt.cfg()).Describe()
+
+			if !reflect.DeepEqual(desc.Middlewares, tt.wantMiddlewares) {
+				t.Errorf("middlewares = %q, want %q", desc.Middlewares, tt.wantMiddlewares)
+			}
+			if !reflect.DeepEqual(desc.Limits, tt.wantLimits) {
+				t.Errorf("limits = %v, want %v", desc.Limits, tt.wantLimits)
+			}
+			for name, want := range tt.wantFeatures {
+				if got := desc.Features[name]; got != want {
+					t.Errorf("feature %s = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildStackDefaultsSupportHijack(t *testing.T) {
+	stack := BuildStack(DefaultStackConfig())
+	stack.HandleFunc("GET /ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Hijack() error = %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+	})
+	srv := httptest.NewServer(stack.Handler())
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("status = %d, want %d", res.StatusCode, http.StatusSwitchingProtocols)
+	}
+}
+
+func TestLoadStackConfigJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    func(*StackConfig)
+		wantErr string
+	}{
+		{
+			name: "empty object keeps the defaults",
+			json: `{}`,
+			want: func(*StackConfig) {},
+		},
+		{
+			name: "fields",
+			json: `{
+				"logging": false,
+				"max_body_bytes": 5242880,
+				"request_timeout": "10s",
+				"auth_tokens": ["a", "b"],
+				"cors": {"allowed_origins": ["https://app.example.com"], "allow_credentials": true, "max_age": "1h"}
+			}`,
+			want: func(cfg *StackConfig) {
+				cfg.Logging = false
+				cfg.MaxBodyBytes = 5 << 20
+				cfg.RequestTimeout = Duration(10 * time.Second)
+				cfg.AuthTokens = []string{"a", "b"}
+				cfg.CORS = &CORSConfig{
+					AllowedOrigins:   []string{"https://app.example.com"},
+					AllowCredentials: true,
+					MaxAge:           Duration(time.Hour),
+				}
+			},
+		},
+		{
+			name:    "unknown field",
+			json:    `{"max_body_size": 10}`,
+			wantErr: "unknown field",
+		},
+		{
+			name:    "invalid duration",
+			json:    `{"request_timeout": "soon"}`,
+			wantErr: "invalid duration",
+		},
+		{
+			name:    "wildcard origin with credentials",
+			json:    `{"cors": {"allowed_origins": ["*"], "allow_credentials": true}}`,
+			wantErr: "credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadStackConfigJSON(strings.NewReader(tt.json))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadStackConfigJSON() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadStackConfigJSON() error = %v", err)
+			}
+
+			want := DefaultStackConfig()
+			tt.want(&want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("LoadStackConfigJSON() = %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestLoadStackConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    func(*StackConfig)
+		wantErr string
+	}{
+		{
+			name: "no variables keeps the defaults",
+			want: func(*StackConfig) {},
+		},
+		{
+			name: "empty variables are ignored",
+			env:  map[string]string{"TEST_LOGGING": "", "TEST_CORS_ALLOWED_ORIGINS": ""},
+			want: func(*StackConfig) {},
+		},
+		{
+			name: "fields",
+			env: map[string]string{
+				"TEST_REQUEST_ID":      "false",
+				"TEST_MAX_BODY_BYTES":  "2048",
+				"TEST_REQUEST_TIMEOUT": "1m30s",
+				"TEST_COMPRESSION":     "0",
+				"TEST_AUTH_TOKENS":     " a, b ,,",
+			},
+			want: func(cfg *StackConfig) {
+				cfg.RequestID = false
+				cfg.MaxBodyBytes = 2048
+				cfg.RequestTimeout = Duration(90 * time.Second)
+				cfg.Compression = false
+				cfg.AuthTokens = []string{"a", "b"}
+			},
+		},
+		{
+			name: "cors",
+			env: map[string]string{
+				"TEST_CORS_ALLOWED_ORIGINS":   "https://a.example.com,https://b.example.com",
+				"TEST_CORS_ALLOWED_METHODS":   "GET,DELETE",
+				"TEST_CORS_EXPOSED_HEADERS":   "X-Request-ID",
+				"TEST_CORS_ALLOW_CREDENTIALS": "true",
+				"TEST_CORS_MAX_AGE":           "10m",
+			},
+			want: func(cfg *StackConfig) {
+				cfg.CORS = &CORSConfig{
+					AllowedOrigins:   []string{"https://a.example.com", "https://b.example.com"},
+					AllowedMethods:   []string{"GET", "DELETE"},
+					ExposedHeaders:   []string{"X-Request-ID"},
+					AllowCredentials: true,
+					MaxAge:           Duration(10 * time.Minute),
+				}
+			},
+		},
+		{
+			name: "cors options without origins",
+			env:  map[string]string{"TEST_CORS_ALLOW_CREDENTIALS": "true"},
+			want: func(*StackConfig) {},
+		},
+		{
+			name:    "invalid bool",
+			env:     map[string]string{"TEST_LOGGING": "maybe"},
+			wantErr: "TEST_LOGGING",
+		},
+		{
+			name:    "invalid int",
+			env:     map[string]string{"TEST_MAX_BODY_BYTES": "1MB"},
+			wantErr: "TEST_MAX_BODY_BYTES",
+		},
+		{
+			name:    "invalid duration",
+			env:     map[string]string{"TEST_REQUEST_TIMEOUT": "30"},
+			wantErr: "TEST_REQUEST_TIMEOUT",
+		},
+		{
+			name:    "first error wins",
+			env:     map[string]string{"TEST_LOGGING": "maybe", "TEST_CORS_ALLOWED_ORIGINS": "*", "TEST_CORS_MAX_AGE": "x"},
+			wantErr: "TEST_LOGGING",
+		},
+		{
+			name:    "wildcard origin with credentials",
+			env:     map[string]string{"TEST_CORS_ALLOWED_ORIGINS": "*", "TEST_CORS_ALLOW_CREDENTIALS": "true"},
+			wantErr: "credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := LoadStackConfigFromEnv("TEST_")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadStackConfigFromEnv() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadStackConfigFromEnv() error = %v", err)
+			}
+
+			want := DefaultStackConfig()
+			tt.want(&want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("LoadStackConfigFromEnv() = %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestStackConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cors    *CORSConfig
+		wantErr bool
+	}{
+		{"no cors", nil, false},
+		{"wildcard", &CORSConfig{AllowedOrigins: []string{"*"}}, false},
+		{"credentials for listed origins", &CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}, false},
+		{"credentials for the wildcard", &CORSConfig{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultStackConfig()
+			cfg.CORS = tt.cors
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDurationText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Duration
+		wantErr bool
+	}{
+		{text: "30s", want: Duration(30 * time.Second)},
+		{text: "1m30s", want: Duration(90 * time.Second)},
+		{text: "1h0m0s", want: Duration(time.Hour)},
+		{text: "250ms", want: Duration(250 * time.Millisecond)},
+		{text: "0s", want: 0},
+		{text: "30", wantErr: true},
+		{text: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			// YAML and other decoders go through encoding.TextUnmarshaler
+			var d Duration
+			var u encoding.TextUnmarshaler = &d
+			err := u.UnmarshalText([]byte(tt.text))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalText(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if d != tt.want {
+				t.Errorf("UnmarshalText(%q) = %v, want %v", tt.text, d, tt.want)
+			}
+
+			var m encoding.TextMarshaler = d
+			text, err := m.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var back Duration
+			if err := back.UnmarshalText(text); err != nil || back != d {
+				t.Errorf("round trip through %q = %v, %v, want %v", text, back, err, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package httputil
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/iam-kevin/go-errors"
+)
+
+// CORSConfig configures MiddlewareCORS.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests. "*" allows any origin
+	AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins"`
+	// AllowedMethods lists the methods allowed in preflight requests. Defaults to GET, HEAD and POST
+	AllowedMethods []string `json:"allowed_methods" yaml:"allowed_methods"`
+	// AllowedHeaders lists the request headers allowed in preflight requests.
+	// Defaults to Content-Type and Authorization
+	AllowedHeaders []string `json:"allowed_headers" yaml:"allowed_headers"`
+	// ExposedHeaders lists the response headers readable by the browser
+	ExposedHeaders []string `json:"exposed_headers" yaml:"exposed_headers"`
+	// AllowCredentials allows cookies and authorization headers on cross-origin requests.
+	// It cannot be combined with the "*" origin
+	AllowCredentials bool `json:"allow_credentials" yaml:"allow_credentials"`
+	// MaxAge is how long preflight results may be cached by the browser
+	MaxAge Duration `json:"max_age" yaml:"max_age"`
+}
+
+// allowsOrigin reports whether the origin is allowed.
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	return slices.Contains(c.AllowedOrigins, "*") || slices.Contains(c.AllowedOrigins, origin)
+}
+
+// validate rejects credentials for any origin, which the Fetch standard forbids.
+func (c CORSConfig) validate() error {
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return errors.New(`CORS credentials cannot be allowed for the "*" origin`)
+	}
+
+	return nil
+}
+
+// MiddlewareCORS returns a middleware handling Cross-Origin Resource Sharing.
+//
+// Preflight requests from allowed origins are answered with HTTP 204 No Content and
+// never reach the handler. Requests from origins that are not allowed are passed
+// through without CORS headers, leaving the browser to block them.
+//
+// It panics if the config allows credentials for the "*" origin, as that would let
+// any site make authenticated requests.
+//
+// Example:
+//
+//	handler := httputil.MiddlewareCORS(httputil.CORSConfig{
+//		AllowedOrigins: []string{"https://app.example.com"},
+//		AllowedMethods: []string{"GET", "POST", "DELETE"},
+//	})(mux)
+func MiddlewareCORS(cfg CORSConfig) Middleware {
+	if err := cfg.validate(); err != nil {
+		panic("httputil: MiddlewareCORS: " + err.Error())
+	}
+
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Content-Type", "Authorization"}
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			if origin == "" || !cfg.allowsOrigin(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if cfg.AllowCredentials || !slices.Contains(cfg.AllowedOrigins, "*") {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				if cfg.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Duration().Seconds())))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if exposeHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
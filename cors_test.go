@@ -0,0 +1,115 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareCORS(t *testing.T) {
+	tests := []struct {
+		name            string
+		cfg             CORSConfig
+		method          string
+		origin          string
+		preflight       bool
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{
+			name:       "allowed origin",
+			cfg:        CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+			method:     http.MethodGet,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://app.example.com",
+		},
+		{
+			name:       "other origin",
+			cfg:        CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+			method:     http.MethodGet,
+			origin:     "https://evil.example",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no origin",
+			cfg:        CORSConfig{AllowedOrigins: []string{"*"}},
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wildcard",
+			cfg:        CORSConfig{AllowedOrigins: []string{"*"}},
+			method:     http.MethodGet,
+			origin:     "https://evil.example",
+			wantStatus: http.StatusOK,
+			wantOrigin: "*",
+		},
+		{
+			name:            "credentials",
+			cfg:             CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true},
+			method:          http.MethodGet,
+			origin:          "https://app.example.com",
+			wantStatus:      http.StatusOK,
+			wantOrigin:      "https://app.example.com",
+			wantCredentials: "true",
+		},
+		{
+			name:       "preflight",
+			cfg:        CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+			method:     http.MethodOptions,
+			origin:     "https://app.example.com",
+			preflight:  true,
+			wantStatus: http.StatusNoContent,
+			wantOrigin: "https://app.example.com",
+		},
+		{
+			name:       "preflight from other origin",
+			cfg:        CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+			method:     http.MethodOptions,
+			origin:     "https://evil.example",
+			preflight:  true,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			rec := httptest.NewRecorder()
+
+			MiddlewareCORS(tt.cfg)(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+		})
+	}
+}
+
+func TestMiddlewareCORSRejectsWildcardCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MiddlewareCORS did not panic for credentials with the \"*\" origin")
+		}
+	}()
+
+	MiddlewareCORS(CORSConfig{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true})
+}
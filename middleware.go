@@ -0,0 +1,248 @@
+package httputil
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RequestIDHeader is the header carrying the request ID.
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	routeKey
+)
+
+// RequestID returns the request ID stored in the context by MiddlewareRequestID,
+// or an empty string if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// validRequestID reports whether an incoming request ID is safe to reuse.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MiddlewareRequestID is a middleware that assigns an ID to every request.
+//
+// A well-formed X-Request-ID header sent by the client (or a proxy in front) is
+// reused, otherwise a random ID is generated. The ID is echoed in the response
+// header and can be read from the request context with RequestID.
+//
+// Example:
+//
+//	slog.Info("creating user", "request_id", httputil.RequestID(r.Context()))
+func MiddlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// newRequestID generates a random 128 bit hex encoded ID.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// statusWriter records the status code and the number of bytes written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher when the underlying writer supports it.
+func (sw *statusWriter) Flush() {
+	http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// statusCode returns the recorded status, 200 if nothing was written.
+func (sw *statusWriter) statusCode() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+	return sw.status
+}
+
+// MiddlewareLogging is a middleware that logs every request once it completes,
+// with its method, path, status, response size, duration and request ID.
+func MiddlewareLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		slog.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", sw.statusCode(),
+			"bytes", sw.bytes,
+			"duration", time.Since(start),
+			"request_id", RequestID(r.Context()),
+		)
+	})
+}
+
+// MetricsRecorder receives one observation per request from MiddlewareMetrics.
+// It is meant to be implemented on top of the metrics library in use (Prometheus, OpenTelemetry, ...).
+type MetricsRecorder interface {
+	// ObserveRequest records a completed request. route is the matched Stack pattern,
+	// or an empty string when not served through a Stack or when no route matched
+	ObserveRequest(method, route string, status int, duration time.Duration)
+}
+
+// routeHolder receives the pattern matched by the Stack mux for use by outer middlewares.
+type routeHolder struct {
+	pattern atomic.Value
+}
+
+// route returns the recorded pattern, if any.
+func (h *routeHolder) route() string {
+	p, _ := h.pattern.Load().(string)
+	return p
+}
+
+// MiddlewareMetrics returns a middleware reporting every request to the recorder.
+//
+// Example:
+//
+//	handler := httputil.MiddlewareMetrics(recorder)(mux)
+func MiddlewareMetrics(recorder MetricsRecorder) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			holder := &routeHolder{}
+
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), routeKey, holder)))
+
+			recorder.ObserveRequest(r.Method, holder.route(), sw.statusCode(), time.Since(start))
+		})
+	}
+}
+
+// MiddlewareMaxBodyBytes returns a middleware limiting request bodies to n bytes.
+// Reading past the limit fails with an *http.MaxBytesError.
+func MiddlewareMaxBodyBytes(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MiddlewareTimeout returns a middleware answering with HTTP 503 Service Unavailable
+// and a JSON error body when the handler does not complete within d.
+//
+// The response is buffered in memory until the handler returns, and the writer passed
+// to the handler supports neither http.Flusher nor http.Hijacker, so it must not be
+// used for streaming responses, server-sent events, large downloads or websockets.
+func MiddlewareTimeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tw := &timeoutWriter{ResponseWriter: w}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r)
+				tw.handled.Store(true)
+			})
+			http.TimeoutHandler(handler, d, `{"ok":false,"message":"request timeout"}`).ServeHTTP(tw, r)
+		})
+	}
+}
+
+// timeoutWriter sets the JSON Content-Type on the 503 response http.TimeoutHandler
+// writes when the handler has not returned in time, which it sends without one.
+type timeoutWriter struct {
+	http.ResponseWriter
+	handled atomic.Bool
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && !tw.handled.Load() {
+		tw.Header().Set("Content-Type", "application/json")
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// MiddlewareBearerToken returns a middleware rejecting requests without an
+// `Authorization: Bearer <token>` header matching one of the tokens,
+// with HTTP 401 Unauthorized.
+//
+// Example:
+//
+//	handler := httputil.MiddlewareBearerToken(os.Getenv("API_TOKEN"))(mux)
+func MiddlewareBearerToken(tokens ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the auth scheme is case-insensitive (RFC 9110, section 11.1)
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			token = strings.TrimLeft(token, " ")
+			if strings.EqualFold(scheme, "Bearer") && token != "" {
+				for _, t := range tokens {
+					if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			ErrorWithStatus(w, http.StatusUnauthorized, "unauthorized")
+		})
+	}
+}
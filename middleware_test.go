@@ -0,0 +1,112 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{
+			name: "timed out",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantType:   "application/json",
+			wantBody:   `{"ok":false,"message":"request timeout"}`,
+		},
+		{
+			name: "completed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("created"))
+			},
+			wantStatus: http.StatusCreated,
+			wantType:   "text/plain",
+			wantBody:   "created",
+		},
+		{
+			name: "handler's own 503",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("maintenance"))
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantType:   "text/plain",
+			wantBody:   "maintenance",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			MiddlewareTimeout(20*time.Millisecond)(tt.handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMiddlewareBearerToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"valid token", "Bearer secret", http.StatusOK},
+		{"other valid token", "Bearer other", http.StatusOK},
+		{"lowercase scheme", "bearer secret", http.StatusOK},
+		{"uppercase scheme", "BEARER secret", http.StatusOK},
+		{"extra spaces", "Bearer   secret", http.StatusOK},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"token prefix", "Bearer secre", http.StatusUnauthorized},
+		{"missing token", "Bearer ", http.StatusUnauthorized},
+		{"scheme only", "Bearer", http.StatusUnauthorized},
+		{"other scheme", "Basic secret", http.StatusUnauthorized},
+		{"no header", "", http.StatusUnauthorized},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			MiddlewareBearerToken("secret", "other")(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Authorization %q: status = %d, want %d", tt.authorization, rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want %q", rec.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
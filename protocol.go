@@ -0,0 +1,110 @@
+package httputil
+
+import (
+	"net/http"
+)
+
+// UpgradeRequired sends a JSON error response with HTTP 426 Upgrade Required status.
+// The Upgrade header is set to the given protocols (e.g. "TLS/1.2, HTTP/1.1" or "h2c"),
+// telling the client which protocol it must switch to before retrying.
+//
+// Upgrade and Connection are connection-specific headers that HTTP/2 and later forbid
+// (RFC 9113, section 8.2.2), so they are left out when r was received over HTTP/2.
+//
+// The response format is:
+//
+//	{
+//		"ok": false,
+//		"message": "error message"
+//	}
+//
+// Example:
+//
+//	httputil.UpgradeRequired(w, r, "websocket", "websocket upgrade required")
+func UpgradeRequired(w http.ResponseWriter, r *http.Request, upgrade string, err interface{}) {
+	if r.ProtoMajor < 2 {
+		w.Header().Set("Upgrade", upgrade)
+		w.Header().Set("Connection", "Upgrade")
+	}
+	ErrorWithStatus(w, http.StatusUpgradeRequired, err)
+}
+
+// HTTPVersionNotSupported sends a JSON error response with HTTP 505 HTTP Version Not Supported status.
+// If upgrade is not empty and r was received over HTTP/1.x, the Upgrade header is set
+// to advertise the protocols the endpoint does support.
+//
+// Example:
+//
+//	httputil.HTTPVersionNotSupported(w, r, "HTTP/2.0", "HTTP/1.x is not supported")
+func HTTPVersionNotSupported(w http.ResponseWriter, r *http.Request, upgrade string, err interface{}) {
+	if upgrade != "" && r.ProtoMajor < 2 {
+		w.Header().Set("Upgrade", upgrade)
+	}
+	ErrorWithStatus(w, http.StatusHTTPVersionNotSupported, err)
+}
+
+// MiddlewareRequireTLS is a middleware that rejects requests not received over TLS.
+//
+// Plain-text requests are answered with HTTP 426 Upgrade Required and an
+// `Upgrade: TLS/1.2, HTTP/1.1` header, as described in RFC 2817. Cleartext HTTP/2
+// (h2c) requests get the 426 without the header, which HTTP/2 does not allow.
+//
+// Example:
+//
+//	mux.Handle("/internal/", httputil.MiddlewareRequireTLS(internalHandler))
+func MiddlewareRequireTLS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			UpgradeRequired(w, r, "TLS/1.2, HTTP/1.1", "TLS is required for this endpoint")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MiddlewareRequireHTTP11 is a middleware that rejects requests made with a protocol
+// older than HTTP/1.1, such as HTTP/1.0 clients hitting a websocket endpoint.
+//
+// Such requests are answered with HTTP 426 Upgrade Required and an `Upgrade: HTTP/1.1`
+// header (RFC 9110, section 15.5.22); 505 is kept for unsupported major versions.
+//
+// Example:
+//
+//	mux.Handle("/ws", httputil.MiddlewareRequireHTTP11(wsHandler))
+func MiddlewareRequireHTTP11(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.ProtoAtLeast(1, 1) {
+			UpgradeRequired(w, r, "HTTP/1.1", r.Proto+" is not supported, use HTTP/1.1 or higher")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MiddlewareRequireHTTP2 is a middleware that rejects requests not made over HTTP/2,
+// for endpoints that are only meant to be reached over h2 or h2c.
+//
+// Such requests are answered with HTTP 505 HTTP Version Not Supported and no Upgrade
+// header: over TLS, HTTP/2 is negotiated through ALPN only, and cleartext HTTP/2 is
+// served to clients using prior knowledge rather than through an `Upgrade: h2c`
+// exchange (see RFC 9113, sections 3.2 and 3.3).
+//
+// Example:
+//
+//	mux.Handle("/grpc/", httputil.MiddlewareRequireHTTP2(grpcHandler))
+func MiddlewareRequireHTTP2(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoAtLeast(2, 0) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.TLS != nil {
+			HTTPVersionNotSupported(w, r, "", r.Proto+" is not supported, negotiate HTTP/2 (h2) through ALPN")
+		} else {
+			HTTPVersionNotSupported(w, r, "", r.Proto+" is not supported, use HTTP/2 with prior knowledge (h2c)")
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package httputil
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtocolMiddlewares(t *testing.T) {
+	tests := []struct {
+		name           string
+		middleware     Middleware
+		protoMajor     int
+		protoMinor     int
+		tls            bool
+		wantStatus     int
+		wantUpgrade    string
+		wantConnection string
+	}{
+		{
+			name:           "HTTP/1.0 to RequireHTTP11",
+			middleware:     MiddlewareRequireHTTP11,
+			protoMajor:     1,
+			protoMinor:     0,
+			wantStatus:     http.StatusUpgradeRequired,
+			wantUpgrade:    "HTTP/1.1",
+			wantConnection: "Upgrade",
+		},
+		{
+			name:       "HTTP/1.1 to RequireHTTP11",
+			middleware: MiddlewareRequireHTTP11,
+			protoMajor: 1,
+			protoMinor: 1,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "HTTP/2 to RequireHTTP11",
+			middleware: MiddlewareRequireHTTP11,
+			protoMajor: 2,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:           "plaintext HTTP/1.1 to RequireTLS",
+			middleware:     MiddlewareRequireTLS,
+			protoMajor:     1,
+			protoMinor:     1,
+			wantStatus:     http.StatusUpgradeRequired,
+			wantUpgrade:    "TLS/1.2, HTTP/1.1",
+			wantConnection: "Upgrade",
+		},
+		{
+			name:       "h2c to RequireTLS",
+			middleware: MiddlewareRequireTLS,
+			protoMajor: 2,
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:       "TLS to RequireTLS",
+			middleware: MiddlewareRequireTLS,
+			protoMajor: 1,
+			protoMinor: 1,
+			tls:        true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "HTTP/1.1 over TLS to RequireHTTP2",
+			middleware: MiddlewareRequireHTTP2,
+			protoMajor: 1,
+			protoMinor: 1,
+			tls:        true,
+			wantStatus: http.StatusHTTPVersionNotSupported,
+		},
+		{
+			name:       "plaintext HTTP/1.1 to RequireHTTP2",
+			middleware: MiddlewareRequireHTTP2,
+			protoMajor: 1,
+			protoMinor: 1,
+			wantStatus: http.StatusHTTPVersionNotSupported,
+		},
+		{
+			name:       "h2c to RequireHTTP2",
+			middleware: MiddlewareRequireHTTP2,
+			protoMajor: 2,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.ProtoMajor, req.ProtoMinor = tt.protoMajor, tt.protoMinor
+			req.Proto = "HTTP/1.1"
+			if tt.protoMajor == 2 {
+				req.Proto = "HTTP/2.0"
+			} else if tt.protoMinor == 0 {
+				req.Proto = "HTTP/1.0"
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			} else {
+				req.TLS = nil
+			}
+			rec := httptest.NewRecorder()
+
+			tt.middleware(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Upgrade"); got != tt.wantUpgrade {
+				t.Errorf("Upgrade = %q, want %q", got, tt.wantUpgrade)
+			}
+			if got := rec.Header().Get("Connection"); got != tt.wantConnection {
+				t.Errorf("Connection = %q, want %q", got, tt.wantConnection)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/iam-kevin/go-errors"
+)
+
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultShutdownTimeout   = 10 * time.Second
+)
+
+// ServerConfig holds the configuration used by RunServer.
+// Zero values fall back to sensible defaults.
+type ServerConfig struct {
+	// Addr is the TCP address to listen on, e.g. ":8080"
+	Addr string
+	// Handler serves the incoming requests
+	Handler http.Handler
+
+	// ReadHeaderTimeout bounds the time allowed to read request headers. Defaults to 10s
+	ReadHeaderTimeout time.Duration
+	// IdleTimeout is the time an idle keep-alive connection (HTTP/1.1 or HTTP/2)
+	// is kept open before being closed. Zero means no idle timeout
+	IdleTimeout time.Duration
+	// ShutdownTimeout bounds the graceful shutdown once the context is cancelled, after
+	// which the remaining connections are closed. Defaults to 10s
+	ShutdownTimeout time.Duration
+
+	// H2C enables cleartext HTTP/2 (prior knowledge) alongside HTTP/1.1
+	H2C bool
+	// HTTP2MaxConcurrentStreams limits the number of concurrent streams per HTTP/2
+	// connection. Zero keeps the standard library default
+	HTTP2MaxConcurrentStreams int
+
+	// TLS enables HTTPS, with certificate hot-reloading and optional client certificates
+	TLS *TLSConfig
+	// ACME enables HTTPS with certificates obtained automatically. Cannot be used with TLS
+	ACME *ACMEConfig
+
+	// Admin serves admin endpoints (health, metrics, pprof, ...) on a separate listener
+	Admin *AdminConfig
+}
+
+// Features reports which of the optional server features are enabled,
+// for use with Stack.SetFeatures. mtls is only reported when client certificates
+// are verified.
+func (cfg ServerConfig) Features() map[string]bool {
+	return map[string]bool{
+		"h2c":             cfg.H2C,
+		"tls":             cfg.TLS != nil || cfg.ACME != nil,
+		"tls_cert_reload": cfg.TLS != nil,
+		"mtls":            cfg.TLS != nil && (cfg.TLS.ClientCAFile != "" || cfg.TLS.ClientAuth >= tls.VerifyClientCertIfGiven),
+		"acme":            cfg.ACME != nil,
+		"admin_listener":  cfg.Admin != nil,
+	}
+}
+
+// newServer builds the *http.Server described by the config.
+func newServer(cfg ServerConfig) *http.Server {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           cfg.Handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if srv.ReadHeaderTimeout == 0 {
+		srv.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+
+	if cfg.H2C {
+		var protocols http.Protocols
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		srv.Protocols = &protocols
+	}
+
+	if cfg.HTTP2MaxConcurrentStreams > 0 {
+		srv.HTTP2 = &http.HTTP2Config{
+			MaxConcurrentStreams: cfg.HTTP2MaxConcurrentStreams,
+		}
+	}
+
+	return srv
+}
+
+// RunServer starts an HTTP server with the given config and blocks until the
+// context is cancelled or the server fails.
+//
+// When the context is cancelled, the server is shut down gracefully, waiting up to
+// ShutdownTimeout for in-flight requests to complete.
+//
+// With H2C enabled, clients that speak HTTP/2 with prior knowledge (e.g. gRPC or
+// `curl --http2-prior-knowledge`) are served over HTTP/2 without TLS, while HTTP/1.1
+// clients keep working. Upgrading from HTTP/1.1 through the `Upgrade: h2c` header is
+// not supported. For h2c-only endpoints, MiddlewareRequireHTTP2 rejects HTTP/1.x
+// requests with a 505 telling the client to use prior knowledge.
+//
+// With TLS set, the certificate is reloaded from disk on SIGHUP (and on file change
+// when TLSConfig.ReloadInterval is set) so rotated certificates are picked up without a
+// restart. A failed reload is logged and the previous certificate stays in use.
+//
+// With ACME set, certificates are obtained and renewed automatically instead. If
+// ACMEConfig.HTTPAddr is set, the HTTP-01 challenge listener runs alongside the main
+// one and is shut down with it.
+//
+// With Admin set, the admin handler is served on its own listener and shares the
+// graceful shutdown of the public one. Requests under DefaultAdminOnlyPrefixes and
+// AdminConfig.AdminOnlyPrefixes are answered with 404 on the public listener, and the
+// public handler may not be http.DefaultServeMux, where net/http/pprof registers itself.
+//
+// Example:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//
+//	err := httputil.RunServer(ctx, httputil.ServerConfig{
+//		Addr:                      ":8080",
+//		Handler:                   mux,
+//		H2C:                       true,
+//		HTTP2MaxConcurrentStreams: 250,
+//		IdleTimeout:               2 * time.Minute,
+//	})
+//
+// Serving with mutual TLS:
+//
+//	err := httputil.RunServer(ctx, httputil.ServerConfig{
+//		Addr:    ":8443",
+//		Handler: mux,
+//		TLS: &httputil.TLSConfig{
+//			CertFile:       "/etc/certs/tls.crt",
+//			KeyFile:        "/etc/certs/tls.key",
+//			ClientCAFile:   "/etc/certs/ca.crt",
+//			ReloadInterval: time.Minute,
+//		},
+//	})
+//
+// Serving with Let's Encrypt certificates:
+//
+//	err := httputil.RunServer(ctx, httputil.ServerConfig{
+//		Addr:    ":443",
+//		Handler: mux,
+//		ACME: &httputil.ACMEConfig{
+//			Hosts:    []string{"api.example.com"},
+//			CacheDir: "/var/cache/acme",
+//			HTTPAddr: ":80",
+//		},
+//	})
+//
+// Serving the admin endpoints on a separate port:
+//
+//	err := httputil.RunServer(ctx, httputil.ServerConfig{
+//		Addr:    ":8080",
+//		Handler: mux,
+//		Admin: &httputil.AdminConfig{
+//			Addr: "127.0.0.1:9090",
+//		},
+//	})
+func RunServer(ctx context.Context, cfg ServerConfig) error {
+	if cfg.TLS != nil && cfg.ACME != nil {
+		return errors.New("TLS and ACME cannot be configured together")
+	}
+
+	if cfg.Admin != nil {
+		if err := cfg.Admin.validate(cfg); err != nil {
+			return err
+		}
+	}
+
+	srv := newServer(cfg)
+	servers := []namedServer{{name: "main", srv: srv, h2c: cfg.H2C}}
+
+	if cfg.Admin != nil {
+		srv.Handler = denyPathPrefixes(srv.Handler, cfg.Admin.adminOnlyPrefixes())
+
+		handler := cfg.Admin.Handler
+		if handler == nil {
+			handler = NewAdminMux()
+		}
+		servers = append(servers, namedServer{
+			name: "admin",
+			srv: &http.Server{
+				Addr:              cfg.Admin.Addr,
+				Handler:           handler,
+				ReadHeaderTimeout: srv.ReadHeaderTimeout,
+				IdleTimeout:       srv.IdleTimeout,
+			},
+		})
+	}
+
+	if cfg.TLS != nil {
+		reloader, err := newCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return err
+		}
+
+		srv.TLSConfig, err = cfg.TLS.serverTLSConfig(reloader)
+		if err != nil {
+			return err
+		}
+
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		defer stopWatch()
+		go reloader.watch(watchCtx, cfg.TLS.ReloadInterval)
+	}
+
+	if cfg.ACME != nil {
+		m, err := cfg.ACME.manager()
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = cfg.ACME.serverTLSConfig(m)
+
+		if cfg.ACME.HTTPAddr != "" {
+			servers = append(servers, namedServer{
+				name: "acme-http",
+				srv: &http.Server{
+					Addr:              cfg.ACME.HTTPAddr,
+					Handler:           m.HTTPHandler(nil),
+					ReadHeaderTimeout: srv.ReadHeaderTimeout,
+				},
+			})
+		}
+	}
+
+	timeout := cfg.ShutdownTimeout
+	if timeout == 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	return serve(ctx, timeout, servers...)
+}
+
+// namedServer is an *http.Server along with the name it is logged under.
+type namedServer struct {
+	name string
+	srv  *http.Server
+	h2c  bool
+}
+
+// serve starts all the servers and blocks until the context is cancelled or one of
+// them fails, then shuts all of them down gracefully within the given timeout. Servers
+// still busy after the timeout are closed, interrupting their active connections.
+// Servers with a TLSConfig are served over TLS.
+func serve(ctx context.Context, timeout time.Duration, servers ...namedServer) error {
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, s := range servers {
+		ln, err := net.Listen("tcp", s.srv.Addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	errc := make(chan error, len(servers))
+	for i, s := range servers {
+		ln := listeners[i]
+		go func() {
+			slog.Info("server listening", "server", s.name, "addr", ln.Addr().String(), "tls", s.srv.TLSConfig != nil, "h2c", s.h2c)
+			if s.srv.TLSConfig != nil {
+				errc <- s.srv.ServeTLS(ln, "", "")
+			} else {
+				errc <- s.srv.Serve(ln)
+			}
+		}()
+	}
+
+	var err error
+	running := len(servers)
+	select {
+	case err = <-errc:
+		running--
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, s := range servers {
+		if serr := s.srv.Shutdown(shutdownCtx); serr != nil {
+			// the timeout bounds the shutdown, so close the connections still active
+			s.srv.Close()
+			if err == nil {
+				err = serr
+			}
+		}
+	}
+
+	for ; running > 0; running-- {
+		if serr := <-errc; serr != http.ErrServerClosed && err == nil {
+			err = serr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,279 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	// taken holds an address another listener is already bound to
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	// free is an address nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	free := ln.Addr().String()
+	ln.Close()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+
+	tests := []struct {
+		name string
+		// servers returns the servers to run; requests are sent to the first one
+		servers func() []namedServer
+		timeout time.Duration
+		// handler, when set, serves the request sent to the first server before cancelling
+		handler http.Handler
+		wantErr string
+		// listenFails is set when serve fails before any server is started
+		listenFails bool
+	}{
+		{
+			name: "cancelled context",
+			servers: func() []namedServer {
+				return []namedServer{
+					{name: "main", srv: &http.Server{Addr: "127.0.0.1:0", Handler: ok}},
+					{name: "admin", srv: &http.Server{Addr: "127.0.0.1:0", Handler: ok}},
+				}
+			},
+			timeout: time.Second,
+		},
+		{
+			name: "listen failure",
+			servers: func() []namedServer {
+				return []namedServer{
+					{name: "main", srv: &http.Server{Addr: free, Handler: ok}},
+					{name: "admin", srv: &http.Server{Addr: taken.Addr().String(), Handler: ok}},
+				}
+			},
+			timeout:     time.Second,
+			wantErr:     "address already in use",
+			listenFails: true,
+		},
+		{
+			name: "serve failure",
+			servers: func() []namedServer {
+				return []namedServer{
+					{name: "main", srv: &http.Server{Addr: "127.0.0.1:0", Handler: ok}},
+					// without any certificate, ServeTLS tries to load one from an empty path and fails
+					{name: "admin", srv: &http.Server{Addr: "127.0.0.1:0", Handler: ok, TLSConfig: &tls.Config{}}},
+				}
+			},
+			timeout: time.Second,
+			wantErr: "no such file or directory",
+		},
+		{
+			name: "shutdown timeout",
+			servers: func() []namedServer {
+				return []namedServer{
+					{name: "main", srv: &http.Server{Addr: "127.0.0.1:0"}},
+					{name: "admin", srv: &http.Server{Addr: "127.0.0.1:0", Handler: ok}},
+				}
+			},
+			timeout: 50 * time.Millisecond,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			}),
+			wantErr: context.DeadlineExceeded.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := tt.servers()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			handled := make(chan struct{})
+			if tt.handler != nil {
+				started := make(chan struct{})
+				servers[0].srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					tt.handler.ServeHTTP(w, r)
+					close(handled)
+				})
+				servers[0].srv.BaseContext = func(ln net.Listener) context.Context {
+					go http.Get("http://" + ln.Addr().String())
+					go func() {
+						<-started
+						cancel()
+					}()
+					return context.Background()
+				}
+			} else {
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+
+			err := serve(ctx, tt.timeout, servers...)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("serve() error = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("serve() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+
+			if tt.handler != nil {
+				// the handler only returns once its connection is closed
+				select {
+				case <-handled:
+				case <-time.After(time.Second):
+					t.Error("the handler context was not cancelled after serve returned")
+				}
+			}
+
+			if tt.listenFails {
+				// the listeners opened before the failure must have been released
+				ln, err := net.Listen("tcp", servers[0].srv.Addr)
+				if err != nil {
+					t.Fatalf("listener of server %s was not closed: %v", servers[0].name, err)
+				}
+				ln.Close()
+				return
+			}
+
+			// every server must have been shut down, whichever one failed
+			for _, s := range servers {
+				if serr := s.srv.ListenAndServe(); !errors.Is(serr, http.ErrServerClosed) {
+					t.Errorf("server %s was not shut down: ListenAndServe() = %v", s.name, serr)
+				}
+			}
+		})
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	tests := []struct {
+		name                  string
+		cfg                   ServerConfig
+		wantH2C               bool
+		wantMaxStreams        int
+		wantReadHeaderTimeout time.Duration
+	}{
+		{
+			name:                  "defaults",
+			cfg:                   ServerConfig{},
+			wantReadHeaderTimeout: defaultReadHeaderTimeout,
+		},
+		{
+			name:                  "h2c",
+			cfg:                   ServerConfig{H2C: true},
+			wantH2C:               true,
+			wantReadHeaderTimeout: defaultReadHeaderTimeout,
+		},
+		{
+			name:                  "max concurrent streams",
+			cfg:                   ServerConfig{HTTP2MaxConcurrentStreams: 250},
+			wantMaxStreams:        250,
+			wantReadHeaderTimeout: defaultReadHeaderTimeout,
+		},
+		{
+			name:                  "read header timeout",
+			cfg:                   ServerConfig{ReadHeaderTimeout: time.Second},
+			wantReadHeaderTimeout: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(tt.cfg)
+
+			if tt.wantH2C {
+				p := srv.Protocols
+				if p == nil || !p.HTTP1() || !p.HTTP2() || !p.UnencryptedHTTP2() {
+					t.Errorf("Protocols = %v, want HTTP1, HTTP2 and UnencryptedHTTP2", p)
+				}
+			} else if srv.Protocols != nil {
+				t.Errorf("Protocols = %v, want the default", srv.Protocols)
+			}
+
+			if tt.wantMaxStreams == 0 {
+				if srv.HTTP2 != nil {
+					t.Errorf("HTTP2 = %+v, want the default", srv.HTTP2)
+				}
+			} else if srv.HTTP2 == nil || srv.HTTP2.MaxConcurrentStreams != tt.wantMaxStreams {
+				t.Errorf("HTTP2 = %+v, want MaxConcurrentStreams %d", srv.HTTP2, tt.wantMaxStreams)
+			}
+
+			if srv.ReadHeaderTimeout != tt.wantReadHeaderTimeout {
+				t.Errorf("ReadHeaderTimeout = %v, want %v", srv.ReadHeaderTimeout, tt.wantReadHeaderTimeout)
+			}
+		})
+	}
+}
+
+func TestNewServerH2CPriorKnowledge(t *testing.T) {
+	srv := newServer(ServerConfig{
+		H2C: true,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			OK(w)
+		}),
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+
+	res, err := client.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.ProtoMajor != 2 {
+		t.Errorf("ProtoMajor = %d, want 2", res.ProtoMajor)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+}
+
+func TestServerConfigFeatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ServerConfig
+		wantTLS  bool
+		wantMTLS bool
+	}{
+		{"plaintext", ServerConfig{}, false, false},
+		{"tls", ServerConfig{TLS: &TLSConfig{}}, true, false},
+		{"client CA", ServerConfig{TLS: &TLSConfig{ClientCAFile: "ca.crt"}}, true, true},
+		{"requested client certificates", ServerConfig{TLS: &TLSConfig{ClientAuth: tls.RequestClientCert}}, true, false},
+		{"unverified client certificates", ServerConfig{TLS: &TLSConfig{ClientAuth: tls.RequireAnyClientCert}}, true, false},
+		{"verified if given", ServerConfig{TLS: &TLSConfig{ClientAuth: tls.VerifyClientCertIfGiven}}, true, true},
+		{"required and verified", ServerConfig{TLS: &TLSConfig{ClientAuth: tls.RequireAndVerifyClientCert}}, true, true},
+		{"acme", ServerConfig{ACME: &ACMEConfig{}}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			features := tt.cfg.Features()
+			if features["tls"] != tt.wantTLS {
+				t.Errorf("tls = %v, want %v", features["tls"], tt.wantTLS)
+			}
+			if features["mtls"] != tt.wantMTLS {
+				t.Errorf("mtls = %v, want %v", features["mtls"], tt.wantMTLS)
+			}
+		})
+	}
+}
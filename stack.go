@@ -0,0 +1,176 @@
+package httputil
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Middleware wraps an http.Handler with additional behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// namedMiddleware is a middleware along with the name it is reported under.
+type namedMiddleware struct {
+	name string
+	mw   Middleware
+}
+
+// Stack is a self-describing handler: it records the mounted middleware chain, the
+// routes, the configured limits and the enabled features, so they can be inspected at
+// runtime through IntrospectionHandler.
+//
+// Example:
+//
+//	stack := httputil.NewStack()
+//	stack.Use("recoverer", httputil.MiddlewareHTTPAssertionRecoverer)
+//	stack.Use("require-tls", httputil.MiddlewareRequireTLS)
+//	stack.SetLimit("max_body_bytes", 1<<20)
+//	stack.HandleFunc("GET /users", listUsers)
+//
+//	stack.SetFeatures(serverConfig.Features())
+//
+//	admin := httputil.NewAdminMux()
+//	admin.Handle("GET /debug/stack", stack.IntrospectionHandler())
+//
+//	server := &http.Server{Handler: stack.Handler()}
+type Stack struct {
+	mu          sync.RWMutex
+	mux         *http.ServeMux
+	middlewares []namedMiddleware
+	handler     http.Handler
+	routes      []string
+	limits      map[string]interface{}
+	features    map[string]bool
+}
+
+// StackDescription is the JSON document served by Stack.IntrospectionHandler.
+type StackDescription struct {
+	// Middlewares lists the middleware names, outermost first
+	Middlewares []string `json:"middlewares"`
+	// Routes lists the registered patterns, sorted
+	Routes []string `json:"routes"`
+	// Limits holds the configured limits by name
+	Limits map[string]interface{} `json:"limits"`
+	// Features holds the enabled state of each known feature
+	Features map[string]bool `json:"features"`
+}
+
+// NewStack creates an empty Stack.
+func NewStack() *Stack {
+	return &Stack{
+		mux:      http.NewServeMux(),
+		limits:   map[string]interface{}{},
+		features: map[string]bool{},
+	}
+}
+
+// Use appends a middleware to the chain. Middlewares run in the order they were added,
+// the first one being the outermost.
+//
+// The chain is frozen by the first call to Handler; Use panics after that.
+func (s *Stack) Use(name string, mw Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handler != nil {
+		panic("httputil: Stack.Use(" + name + ") called after Stack.Handler")
+	}
+	s.middlewares = append(s.middlewares, namedMiddleware{name: name, mw: mw})
+}
+
+// Handle registers the handler for the given pattern, see http.ServeMux for the pattern syntax.
+func (s *Stack) Handle(pattern string, handler http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mux.Handle(pattern, handler)
+	s.routes = append(s.routes, pattern)
+}
+
+// HandleFunc registers the handler function for the given pattern.
+func (s *Stack) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// SetLimit records a configured limit (body size, timeout, rate, ...) under the given name.
+func (s *Stack) SetLimit(name string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits[name] = value
+}
+
+// SetFeature records whether the named feature is enabled.
+func (s *Stack) SetFeature(name string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.features[name] = enabled
+}
+
+// SetFeatures records the enabled state of several features at once, e.g. ServerConfig.Features().
+func (s *Stack) SetFeatures(features map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, enabled := range features {
+		s.features[name] = enabled
+	}
+}
+
+// Handler returns the routes wrapped by the middleware chain.
+//
+// The first call freezes the chain, so that the middlewares reported by Describe
+// are exactly the ones mounted. Routes can still be added afterwards.
+func (s *Stack) Handler() http.Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handler != nil {
+		return s.handler
+	}
+
+	mux := s.mux
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// report the matched pattern to MiddlewareMetrics, if mounted, even when the handler panics
+		if holder, ok := r.Context().Value(routeKey).(*routeHolder); ok {
+			defer func() { holder.pattern.Store(r.Pattern) }()
+		}
+		mux.ServeHTTP(w, r)
+	})
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		h = s.middlewares[i].mw(h)
+	}
+	s.handler = h
+
+	return h
+}
+
+// Describe returns a snapshot of the stack.
+func (s *Stack) Describe() StackDescription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	desc := StackDescription{
+		Middlewares: make([]string, 0, len(s.middlewares)),
+		Routes:      append([]string{}, s.routes...),
+		Limits:      make(map[string]interface{}, len(s.limits)),
+		Features:    make(map[string]bool, len(s.features)),
+	}
+	for _, m := range s.middlewares {
+		desc.Middlewares = append(desc.Middlewares, m.name)
+	}
+	sort.Strings(desc.Routes)
+	for k, v := range s.limits {
+		desc.Limits[k] = v
+	}
+	for k, v := range s.features {
+		desc.Features[k] = v
+	}
+
+	return desc
+}
+
+// IntrospectionHandler returns a handler answering with the StackDescription as JSON.
+//
+// It exposes the internals of the deployment and is meant to be mounted on the admin
+// listener (see AdminConfig), never on the public one.
+func (s *Stack) IntrospectionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Json(w, s.Describe())
+	})
+}
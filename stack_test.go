@@ -0,0 +1,171 @@
+package httputil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tagMiddleware appends its name to the X-Chain response header.
+func tagMiddleware(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Chain", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestStackMiddlewareOrder(t *testing.T) {
+	s := NewStack()
+	s.Use("first", tagMiddleware("first"))
+	s.Use("second", tagMiddleware("second"))
+	s.Use("third", tagMiddleware("third"))
+	s.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+
+	want := []string{"first", "second", "third"}
+	if got := s.Describe().Middlewares; !reflect.DeepEqual(got, want) {
+		t.Errorf("Describe().Middlewares = %q, want %q", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Values("X-Chain"); !reflect.DeepEqual(got, want) {
+		t.Errorf("middlewares ran in order %q, want %q", got, want)
+	}
+}
+
+func TestStackRoutesAfterHandler(t *testing.T) {
+	s := NewStack()
+	s.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+	h := s.Handler()
+	s.HandleFunc("GET /accounts", func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/users", http.StatusOK},
+		{"/accounts", http.StatusOK},
+		{"/unknown", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+
+	want := []string{"GET /accounts", "GET /users"}
+	if got := s.Describe().Routes; !reflect.DeepEqual(got, want) {
+		t.Errorf("Describe().Routes = %q, want %q", got, want)
+	}
+	if s.Handler() == nil {
+		t.Error("second Handler() call returned nil")
+	}
+}
+
+func TestStackUseAfterHandler(t *testing.T) {
+	s := NewStack()
+	s.Use("first", tagMiddleware("first"))
+	s.Handler()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Use after Handler did not panic")
+		}
+		if got, want := s.Describe().Middlewares, []string{"first"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Describe().Middlewares = %q, want %q", got, want)
+		}
+	}()
+	s.Use("late", tagMiddleware("late"))
+}
+
+func TestStackIntrospectionHandler(t *testing.T) {
+	s := NewStack()
+	s.Use("recoverer", MiddlewareHTTPAssertionRecoverer)
+	s.Use("require-tls", MiddlewareRequireTLS)
+	s.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {})
+	s.HandleFunc("POST /users", func(w http.ResponseWriter, r *http.Request) {})
+	s.SetLimit("max_body_bytes", 1<<20)
+	s.SetFeature("h2c", true)
+	s.SetFeatures(map[string]bool{"tls": false, "h2c": false})
+
+	rec := httptest.NewRecorder()
+	s.IntrospectionHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/stack", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want %q", got, "application/json")
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"middlewares": []interface{}{"recoverer", "require-tls"},
+		"routes":      []interface{}{"GET /users", "POST /users"},
+		"limits":      map[string]interface{}{"max_body_bytes": float64(1 << 20)},
+		"features":    map[string]interface{}{"h2c": false, "tls": false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("introspection = %s, want %v", strings.TrimSpace(rec.Body.String()), want)
+	}
+}
+
+// recorder is a MetricsRecorder keeping the observations in memory.
+type recorder struct {
+	mu           sync.Mutex
+	observations []observation
+}
+
+type observation struct {
+	method string
+	route  string
+	status int
+}
+
+func (r *recorder) ObserveRequest(method, route string, status int, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observations = append(r.observations, observation{method: method, route: route, status: status})
+}
+
+func TestStackMetricsRoute(t *testing.T) {
+	rec := &recorder{}
+	s := NewStack()
+	s.Use("metrics", MiddlewareMetrics(rec))
+	s.Use("recoverer", MiddlewareHTTPAssertionRecoverer)
+	s.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		OK(w)
+	})
+	s.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	h := s.Handler()
+
+	for _, path := range []string{"/users/42", "/panic", "/unknown"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	want := []observation{
+		{method: http.MethodGet, route: "GET /users/{id}", status: http.StatusOK},
+		{method: http.MethodGet, route: "GET /panic", status: http.StatusInternalServerError},
+		{method: http.MethodGet, route: "", status: http.StatusNotFound},
+	}
+	if !reflect.DeepEqual(rec.observations, want) {
+		t.Errorf("observations = %+v, want %+v", rec.observations, want)
+	}
+}
@@ -0,0 +1,186 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/iam-kevin/go-errors"
+)
+
+// TLSConfig configures HTTPS for RunServer.
+//
+// The certificate and key are loaded from disk and reloaded without a restart
+// whenever the process receives SIGHUP, or when the files change if
+// ReloadInterval is set.
+type TLSConfig struct {
+	// CertFile is the path to the PEM encoded certificate (chain)
+	CertFile string
+	// KeyFile is the path to the PEM encoded private key
+	KeyFile string
+
+	// ClientCAFile is the path to a PEM bundle of CAs used to verify client certificates.
+	// Setting it without ClientAuth requires and verifies client certificates
+	ClientCAFile string
+	// ClientAuth is the client certificate policy, e.g. tls.RequireAndVerifyClientCert
+	ClientAuth tls.ClientAuthType
+
+	// MinVersion is the minimum accepted TLS version. Defaults to TLS 1.2
+	MinVersion uint16
+	// ReloadInterval is how often the certificate files are checked for changes.
+	// Zero disables polling; SIGHUP always triggers a reload
+	ReloadInterval time.Duration
+}
+
+// serverTLSConfig builds the *tls.Config for the server, serving certificates
+// from the given reloader.
+func (c TLSConfig) serverTLSConfig(reloader *certReloader) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     c.MinVersion,
+		GetCertificate: reloader.GetCertificate,
+		ClientAuth:     c.ClientAuth,
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", c.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+
+		if cfg.ClientAuth == tls.NoClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if cfg.ClientAuth >= tls.VerifyClientCertIfGiven {
+		return nil, errors.New("client certificate verification requires a ClientCAFile")
+	}
+
+	return cfg, nil
+}
+
+// certReloader holds the current server certificate and swaps it
+// when the files on disk are reloaded.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the certificate pair, failing if it cannot be read.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate returns the current certificate. It is meant to be used as tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// reload reads the certificate pair from disk. On failure the previous certificate is kept.
+func (r *certReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return nil
+}
+
+// latestModTime returns the most recent modification time of the certificate and key files.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// changed reports whether the files on disk are newer than the loaded certificate.
+func (r *certReloader) changed() bool {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !modTime.Equal(r.modTime)
+}
+
+// watch reloads the certificate on SIGHUP and, if interval > 0, whenever the files change.
+// It returns once the context is cancelled.
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+			if !r.changed() {
+				continue
+			}
+		}
+
+		if err := r.reload(); err != nil {
+			slog.Error("certificate reload failed, keeping previous certificate", "error", err)
+			continue
+		}
+		slog.Info("certificate reloaded", "cert", r.certFile)
+	}
+}
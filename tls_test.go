@@ -0,0 +1,279 @@
+package httputil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertPair writes a self-signed certificate for the common name to certFile and
+// keyFile, setting their modification time to modTime.
+func writeCertPair(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), modTime)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), modTime)
+}
+
+func writeFile(t *testing.T, name string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commonName returns the subject common name of the reloader's current certificate.
+func commonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestNewCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeCertPair(t, certFile, keyFile, "initial", time.Now())
+	garbage := filepath.Join(dir, "garbage.pem")
+	writeFile(t, garbage, []byte("not a certificate"), time.Now())
+
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		wantErr  bool
+	}{
+		{"valid pair", certFile, keyFile, false},
+		{"missing cert", filepath.Join(dir, "missing.crt"), keyFile, true},
+		{"missing key", certFile, filepath.Join(dir, "missing.key"), true},
+		{"invalid cert", garbage, keyFile, true},
+		{"invalid key", certFile, garbage, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newCertReloader(tt.certFile, tt.keyFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newCertReloader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && commonName(t, r) != "initial" {
+				t.Errorf("certificate = %q, want %q", commonName(t, r), "initial")
+			}
+		})
+	}
+}
+
+func TestCertReloaderReload(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		// update rewrites the files after the initial load
+		update      func(t *testing.T, certFile, keyFile string)
+		wantErr     bool
+		wantName    string
+		wantChanged bool
+	}{
+		{
+			name: "new pair",
+			update: func(t *testing.T, certFile, keyFile string) {
+				writeCertPair(t, certFile, keyFile, "rotated", start.Add(time.Minute))
+			},
+			wantName: "rotated",
+		},
+		{
+			name: "corrupted key",
+			update: func(t *testing.T, certFile, keyFile string) {
+				writeFile(t, keyFile, []byte("not a key"), start.Add(time.Minute))
+			},
+			wantErr:     true,
+			wantName:    "initial",
+			wantChanged: true,
+		},
+		{
+			name: "mismatched pair",
+			update: func(t *testing.T, certFile, keyFile string) {
+				dir := t.TempDir()
+				otherCert, otherKey := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+				writeCertPair(t, otherCert, otherKey, "other", start)
+				data, err := os.ReadFile(otherCert)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, certFile, data, start.Add(time.Minute))
+			},
+			wantErr:     true,
+			wantName:    "initial",
+			wantChanged: true,
+		},
+		{
+			name: "removed cert",
+			update: func(t *testing.T, certFile, keyFile string) {
+				if err := os.Remove(certFile); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:  true,
+			wantName: "initial",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certFile := filepath.Join(dir, "tls.crt")
+			keyFile := filepath.Join(dir, "tls.key")
+			writeCertPair(t, certFile, keyFile, "initial", start)
+
+			r, err := newCertReloader(certFile, keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.changed() {
+				t.Fatal("changed() = true right after loading")
+			}
+
+			tt.update(t, certFile, keyFile)
+			if err := r.reload(); (err != nil) != tt.wantErr {
+				t.Fatalf("reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := commonName(t, r); got != tt.wantName {
+				t.Errorf("certificate = %q, want %q", got, tt.wantName)
+			}
+			if got := r.changed(); got != tt.wantChanged {
+				t.Errorf("changed() = %v, want %v", got, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Hour)
+	writeCertPair(t, certFile, keyFile, "initial", start)
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.watch(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// a broken key is picked up by the poll but must not replace the certificate
+	writeFile(t, keyFile, []byte("not a key"), start.Add(time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if got := commonName(t, r); got != "initial" {
+		t.Fatalf("certificate after failed reload = %q, want %q", got, "initial")
+	}
+
+	writeCertPair(t, certFile, keyFile, "rotated", start.Add(2*time.Minute))
+	deadline := time.Now().Add(5 * time.Second)
+	for commonName(t, r) != "rotated" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate was not reloaded after the files changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTLSConfigServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeCertPair(t, certFile, keyFile, "ca", time.Now())
+	garbage := filepath.Join(dir, "garbage.pem")
+	writeFile(t, garbage, []byte("not a certificate"), time.Now())
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		cfg            TLSConfig
+		wantErr        bool
+		wantMinVersion uint16
+		wantClientAuth tls.ClientAuthType
+	}{
+		{"defaults", TLSConfig{}, false, tls.VersionTLS12, tls.NoClientCert},
+		{"min version", TLSConfig{MinVersion: tls.VersionTLS13}, false, tls.VersionTLS13, tls.NoClientCert},
+		{"client CA requires certificates", TLSConfig{ClientCAFile: certFile}, false, tls.VersionTLS12, tls.RequireAndVerifyClientCert},
+		{"client CA with explicit policy", TLSConfig{ClientCAFile: certFile, ClientAuth: tls.VerifyClientCertIfGiven}, false, tls.VersionTLS12, tls.VerifyClientCertIfGiven},
+		{"unverified client certificates", TLSConfig{ClientAuth: tls.RequireAnyClientCert}, false, tls.VersionTLS12, tls.RequireAnyClientCert},
+		{"verification without client CA", TLSConfig{ClientAuth: tls.RequireAndVerifyClientCert}, true, 0, 0},
+		{"missing client CA", TLSConfig{ClientCAFile: filepath.Join(dir, "missing.pem")}, true, 0, 0},
+		{"invalid client CA", TLSConfig{ClientCAFile: garbage}, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.cfg.serverTLSConfig(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serverTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.MinVersion != tt.wantMinVersion {
+				t.Errorf("MinVersion = %x, want %x", cfg.MinVersion, tt.wantMinVersion)
+			}
+			if cfg.ClientAuth != tt.wantClientAuth {
+				t.Errorf("ClientAuth = %v, want %v", cfg.ClientAuth, tt.wantClientAuth)
+			}
+		})
+	}
+}